@@ -8,8 +8,8 @@ import (
 // CIDRTrie can hold both IPv4 and IPv6 prefixes
 // at the same time.
 type CIDRTrie[T any] struct {
-	v4 Trie[Key[netip.Prefix], T]
-	v6 Trie[Key[netip.Prefix], T]
+	v4 Trie[Key[netip.Prefix], netip.Prefix, T]
+	v6 Trie[Key[netip.Prefix], netip.Prefix, T]
 }
 
 // NewCIDRTrie creates a new CIDRTrie[T any].
@@ -20,6 +20,29 @@ func NewCIDRTrie[T any]() *CIDRTrie[T] {
 	}
 }
 
+// NewCIDRTrieFromSlice builds a CIDRTrie from entries in a single pass
+// over the slice, splitting entries by address family before loading each
+// family's Trie with NewTrieFromSlice.
+func NewCIDRTrieFromSlice[T any](entries []struct {
+	Prefix netip.Prefix
+	Value  T
+}) *CIDRTrie[T] {
+	v4 := make([]Entry[Key[netip.Prefix], T], 0, len(entries))
+	v6 := make([]Entry[Key[netip.Prefix], T], 0, len(entries))
+	for _, e := range entries {
+		entry := Entry[Key[netip.Prefix], T]{Bits: uint(e.Prefix.Bits()), Key: cidrKey(e.Prefix), Value: e.Value}
+		if e.Prefix.Addr().Is6() {
+			v6 = append(v6, entry)
+		} else {
+			v4 = append(v4, entry)
+		}
+	}
+	return &CIDRTrie[T]{
+		v4: NewTrieFromSlice[netip.Prefix, T](32, v4),
+		v6: NewTrieFromSlice[netip.Prefix, T](128, v6),
+	}
+}
+
 // Lookup returns the longest matched value for a given prefix
 func (c *CIDRTrie[T]) Lookup(cidr netip.Prefix) T {
 	return c.treeForFamily(cidr).Lookup(cidrKey(cidr))
@@ -32,6 +55,60 @@ func (c *CIDRTrie[T]) Path(cidr netip.Prefix, fn func(k netip.Prefix, v T) bool)
 	})
 }
 
+// Range calls fn for every stored prefix whose address falls within
+// [start, end] (inclusive), in ascending numeric address order. start and
+// end must be of the same address family; Range does nothing if they are
+// not. Internally this prunes any subtree whose entire address range
+// falls outside [start, end] rather than visiting every stored prefix.
+func (c *CIDRTrie[T]) Range(start, end netip.Prefix, fn func(k netip.Prefix, v T) bool) {
+	if start.Addr().Is6() != end.Addr().Is6() {
+		return
+	}
+	c.treeForFamily(start).Range(cidrKey(start), cidrKey(end), func(_ uint, k Key[netip.Prefix], v T) bool {
+		return fn(k.Value(), v)
+	})
+}
+
+// All calls fn for every stored prefix in ascending numeric address
+// order, IPv4 entries before IPv6 entries.
+func (c *CIDRTrie[T]) All(fn func(k netip.Prefix, v T) bool) {
+	cont := true
+	c.v4.All(func(_ uint, k Key[netip.Prefix], v T) bool {
+		cont = fn(k.Value(), v)
+		return cont
+	})
+	if !cont {
+		return
+	}
+	c.v6.All(func(_ uint, k Key[netip.Prefix], v T) bool {
+		return fn(k.Value(), v)
+	})
+}
+
+// First returns the stored prefix with the smallest address, IPv4 entries
+// sorting before IPv6 entries. ok is false if the trie is empty.
+func (c *CIDRTrie[T]) First() (k netip.Prefix, v T, ok bool) {
+	if fk, fv, found := c.v4.First(); found {
+		return fk.Value(), fv, true
+	}
+	if fk, fv, found := c.v6.First(); found {
+		return fk.Value(), fv, true
+	}
+	return k, v, false
+}
+
+// Last returns the stored prefix with the largest address, IPv6 entries
+// sorting after IPv4 entries. ok is false if the trie is empty.
+func (c *CIDRTrie[T]) Last() (k netip.Prefix, v T, ok bool) {
+	if lk, lv, found := c.v6.Last(); found {
+		return lk.Value(), lv, true
+	}
+	if lk, lv, found := c.v4.Last(); found {
+		return lk.Value(), lv, true
+	}
+	return k, v, false
+}
+
 // Upsert adds or updates the value for a given prefix
 func (c *CIDRTrie[T]) Upsert(cidr netip.Prefix, v T) {
 	c.treeForFamily(cidr).Upsert(uint(cidr.Bits()), cidrKey(cidr), v)
@@ -47,7 +124,96 @@ func (c *CIDRTrie[T]) Len() uint {
 	return c.v4.Len() + c.v6.Len()
 }
 
-func (c *CIDRTrie[T]) treeForFamily(cidr netip.Prefix) Trie[Key[netip.Prefix], T] {
+// Clone returns an immutable snapshot of the trie: an O(1) copy that
+// shares all of the receiver's internal nodes. The snapshot stays valid
+// across later calls to UpsertImmutable/DeleteImmutable on the receiver
+// (or on other snapshots), since those path-copy the nodes they touch
+// rather than editing shared nodes in place. This lets a reader walk a
+// stable view of the trie without holding a lock against the writer.
+func (c *CIDRTrie[T]) Clone() *CIDRTrie[T] {
+	return &CIDRTrie[T]{
+		v4: c.v4.Clone(),
+		v6: c.v6.Clone(),
+	}
+}
+
+// UpsertImmutable adds or updates the value for a given prefix and returns
+// a new trie reflecting the change. The receiver is left untouched: only
+// the nodes on the path to cidr are copied, the rest of the tree is
+// shared between the receiver and the returned trie.
+func (c *CIDRTrie[T]) UpsertImmutable(cidr netip.Prefix, v T) *CIDRTrie[T] {
+	out := c.Clone()
+	if cidr.Addr().Is6() {
+		out.v6 = out.v6.UpsertImmutable(uint(cidr.Bits()), cidrKey(cidr), v)
+	} else {
+		out.v4 = out.v4.UpsertImmutable(uint(cidr.Bits()), cidrKey(cidr), v)
+	}
+	return out
+}
+
+// DeleteImmutable removes a given prefix and returns a new trie reflecting
+// the change, leaving the receiver untouched. ok reports whether the
+// prefix was present to remove.
+func (c *CIDRTrie[T]) DeleteImmutable(cidr netip.Prefix) (out *CIDRTrie[T], ok bool) {
+	out = c.Clone()
+	if cidr.Addr().Is6() {
+		newTrie, existed := out.v6.DeleteImmutable(uint(cidr.Bits()), cidrKey(cidr))
+		out.v6 = newTrie
+		return out, existed
+	}
+	newTrie, existed := out.v4.DeleteImmutable(uint(cidr.Bits()), cidrKey(cidr))
+	out.v4 = newTrie
+	return out, existed
+}
+
+// Union merges other into the receiver, combining values for prefixes
+// present in both using merge. The two tries are walked together so
+// merging is O(n+m), rather than the O(m log n) of re-inserting every
+// entry of other with Upsert.
+func (c *CIDRTrie[T]) Union(other *CIDRTrie[T], merge func(a, b T) T) {
+	c.v4.Union(other.v4, merge)
+	c.v6.Union(other.v6, merge)
+}
+
+// Overlaps returns true if any stored prefix overlaps with p, i.e. either
+// is a supernet of p, is p itself, or is a subnet of p.
+func (c *CIDRTrie[T]) Overlaps(p netip.Prefix) bool {
+	overlaps := false
+	c.Path(p, func(_ netip.Prefix, _ T) bool {
+		overlaps = true
+		return false
+	})
+	if overlaps {
+		return true
+	}
+	c.CoveredBy(p, func(_ netip.Prefix, _ T) bool {
+		overlaps = true
+		return false
+	})
+	return overlaps
+}
+
+// Covering calls fn for every stored prefix that is a strict supernet of
+// p, from least to most specific. Unlike Path, an entry equal to p itself
+// is not visited.
+func (c *CIDRTrie[T]) Covering(p netip.Prefix, fn func(k netip.Prefix, v T) bool) {
+	c.Path(p, func(k netip.Prefix, v T) bool {
+		if k.Bits() == p.Bits() {
+			return true
+		}
+		return fn(k, v)
+	})
+}
+
+// CoveredBy calls fn for every stored prefix that is a strict subnet of p,
+// by descending the subtree rooted at the node matching p.
+func (c *CIDRTrie[T]) CoveredBy(p netip.Prefix, fn func(k netip.Prefix, v T) bool) {
+	c.treeForFamily(p).Subtree(uint(p.Bits()), cidrKey(p), func(_ uint, k Key[netip.Prefix], v T) bool {
+		return fn(k.Value(), v)
+	})
+}
+
+func (c *CIDRTrie[T]) treeForFamily(cidr netip.Prefix) Trie[Key[netip.Prefix], netip.Prefix, T] {
 	if cidr.Addr().Is6() {
 		return c.v6
 	}
@@ -206,3 +206,141 @@ func TestCommonPrefix(t *testing.T) {
 		})
 	}
 }
+
+func TestCIDRTrieOverlapsCoveringCoveredBy(t *testing.T) {
+	trie := NewCIDRTrie[string]()
+
+	prefixes := map[string]netip.Prefix{
+		"8":     netip.MustParsePrefix("10.0.0.0/8"),
+		"16":    netip.MustParsePrefix("10.1.0.0/16"),
+		"24":    netip.MustParsePrefix("10.1.1.0/24"),
+		"other": netip.MustParsePrefix("192.168.0.0/16"),
+	}
+	for name, prefix := range prefixes {
+		trie.Upsert(prefix, name)
+	}
+
+	assert.True(t, trie.Overlaps(netip.MustParsePrefix("10.1.1.128/25")))
+	assert.True(t, trie.Overlaps(netip.MustParsePrefix("10.0.0.0/8")))
+	assert.True(t, trie.Overlaps(netip.MustParsePrefix("10.0.0.0/7")))
+	assert.False(t, trie.Overlaps(netip.MustParsePrefix("172.16.0.0/16")))
+
+	var covering []string
+	trie.Covering(prefixes["24"], func(_ netip.Prefix, v string) bool {
+		covering = append(covering, v)
+		return true
+	})
+	assert.Equal(t, []string{"8", "16"}, covering)
+
+	var coveredBy []string
+	trie.CoveredBy(prefixes["8"], func(_ netip.Prefix, v string) bool {
+		coveredBy = append(coveredBy, v)
+		return true
+	})
+	assert.ElementsMatch(t, []string{"16", "24"}, coveredBy)
+}
+
+func TestCIDRTrieCOW(t *testing.T) {
+	orig := NewCIDRTrie[string]()
+	orig.Upsert(netip.MustParsePrefix("10.0.0.0/8"), "8")
+	orig.Upsert(netip.MustParsePrefix("10.1.0.0/16"), "16")
+
+	snap := orig.Clone()
+
+	// Mutating the receiver after Clone must not affect the snapshot.
+	orig.Upsert(netip.MustParsePrefix("10.1.0.0/16"), "16-updated")
+	orig.Upsert(netip.MustParsePrefix("10.2.0.0/16"), "new")
+	assert.Equal(t, "16", snap.Lookup(netip.MustParsePrefix("10.1.0.0/32")))
+	// snap predates the "new" 10.2.0.0/16 route added to orig after Clone,
+	// so it should still only see the less specific 10.0.0.0/8 ancestor.
+	assert.Equal(t, "8", snap.Lookup(netip.MustParsePrefix("10.2.0.0/32")))
+	assert.EqualValues(t, 2, snap.Len())
+	assert.EqualValues(t, 3, orig.Len())
+
+	// UpsertImmutable/DeleteImmutable must not mutate the receiver, and
+	// only the path to the changed entry should differ between the two.
+	withNew := snap.UpsertImmutable(netip.MustParsePrefix("192.168.0.0/16"), "192")
+	assert.EqualValues(t, 2, snap.Len())
+	assert.EqualValues(t, 3, withNew.Len())
+	assert.Equal(t, "", snap.Lookup(netip.MustParsePrefix("192.168.0.0/32")))
+	assert.Equal(t, "192", withNew.Lookup(netip.MustParsePrefix("192.168.0.0/32")))
+
+	withoutEight, ok := withNew.DeleteImmutable(netip.MustParsePrefix("10.0.0.0/8"))
+	assert.True(t, ok)
+	assert.EqualValues(t, 2, withoutEight.Len())
+	assert.EqualValues(t, 3, withNew.Len())
+	assert.Equal(t, "8", withNew.Lookup(netip.MustParsePrefix("10.0.0.1/32")))
+	assert.Equal(t, "", withoutEight.Lookup(netip.MustParsePrefix("10.0.0.1/32")))
+}
+
+func TestCIDRTrieUnion(t *testing.T) {
+	a := NewCIDRTrie[int]()
+	a.Upsert(netip.MustParsePrefix("10.0.0.0/8"), 1)
+	a.Upsert(netip.MustParsePrefix("10.1.0.0/16"), 2)
+
+	b := NewCIDRTrie[int]()
+	b.Upsert(netip.MustParsePrefix("10.1.0.0/16"), 10)
+	b.Upsert(netip.MustParsePrefix("192.168.0.0/16"), 20)
+
+	a.Union(b, func(x, y int) int { return x + y })
+
+	assert.Equal(t, 1, a.Lookup(netip.MustParsePrefix("10.2.0.0/32")))
+	assert.Equal(t, 12, a.Lookup(netip.MustParsePrefix("10.1.0.0/32")))
+	assert.Equal(t, 20, a.Lookup(netip.MustParsePrefix("192.168.0.0/32")))
+}
+
+func TestNewCIDRTrieFromSlice(t *testing.T) {
+	trie := NewCIDRTrieFromSlice([]struct {
+		Prefix netip.Prefix
+		Value  string
+	}{
+		{netip.MustParsePrefix("10.0.0.0/8"), "a"},
+		{netip.MustParsePrefix("10.1.0.0/16"), "b"},
+		{netip.MustParsePrefix("2001:db8::/32"), "c"},
+	})
+
+	assert.EqualValues(t, 3, trie.Len())
+	assert.Equal(t, "b", trie.Lookup(netip.MustParsePrefix("10.1.2.3/32")))
+	assert.Equal(t, "a", trie.Lookup(netip.MustParsePrefix("10.2.0.0/32")))
+	assert.Equal(t, "c", trie.Lookup(netip.MustParsePrefix("2001:db8::1/128")))
+}
+
+func TestCIDRTrieRangeAllFirstLast(t *testing.T) {
+	trie := NewCIDRTrie[string]()
+	trie.Upsert(netip.MustParsePrefix("10.0.0.0/8"), "10/8")
+	trie.Upsert(netip.MustParsePrefix("10.1.0.0/16"), "10.1/16")
+	trie.Upsert(netip.MustParsePrefix("192.168.0.0/16"), "192.168/16")
+	trie.Upsert(netip.MustParsePrefix("2001:db8::/32"), "2001:db8::/32")
+
+	var all []string
+	trie.All(func(_ netip.Prefix, v string) bool {
+		all = append(all, v)
+		return true
+	})
+	assert.Equal(t, []string{"10/8", "10.1/16", "192.168/16", "2001:db8::/32"}, all)
+
+	var ranged []string
+	trie.Range(
+		netip.MustParsePrefix("10.0.0.0/32"),
+		netip.MustParsePrefix("11.0.0.0/32"),
+		func(_ netip.Prefix, v string) bool {
+			ranged = append(ranged, v)
+			return true
+		},
+	)
+	assert.Equal(t, []string{"10/8", "10.1/16"}, ranged)
+
+	k, v, ok := trie.First()
+	assert.True(t, ok)
+	assert.Equal(t, "10/8", v)
+	assert.Equal(t, netip.MustParsePrefix("10.0.0.0/8"), k)
+
+	k, v, ok = trie.Last()
+	assert.True(t, ok)
+	assert.Equal(t, "2001:db8::/32", v)
+	assert.Equal(t, netip.MustParsePrefix("2001:db8::/32"), k)
+
+	empty := NewCIDRTrie[string]()
+	_, _, ok = empty.First()
+	assert.False(t, ok)
+}
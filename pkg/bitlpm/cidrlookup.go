@@ -0,0 +1,20 @@
+package bitlpm
+
+import "net/netip"
+
+// CIDRLookup is the API shared by CIDRTrie and CIDRTable: a longest-prefix-
+// match structure holding both IPv4 and IPv6 prefixes. NewCIDRLookup picks
+// which of the two backs it, gated by the cidrtable_bart build tag, so
+// callers can be benchmarked against both without changing their code.
+type CIDRLookup[T any] interface {
+	Lookup(cidr netip.Prefix) T
+	Path(cidr netip.Prefix, fn func(k netip.Prefix, v T) bool)
+	Upsert(cidr netip.Prefix, v T)
+	Delete(cidr netip.Prefix) bool
+	Len() uint
+}
+
+var (
+	_ CIDRLookup[struct{}] = (*CIDRTrie[struct{}])(nil)
+	_ CIDRLookup[struct{}] = (*CIDRTable[struct{}])(nil)
+)
@@ -0,0 +1,10 @@
+//go:build cidrtable_bart
+
+package bitlpm
+
+// NewCIDRLookup creates the CIDRLookup implementation selected by the
+// cidrtable_bart build tag: the multi-bit-stride CIDRTable, so it can be
+// benchmarked against the default CIDRTrie on real policy sets.
+func NewCIDRLookup[T any]() CIDRLookup[T] {
+	return NewCIDRTable[T]()
+}
@@ -0,0 +1,49 @@
+package bitlpm
+
+import (
+	"math/rand"
+	"net/netip"
+	"testing"
+)
+
+// genPolicyCIDRs generates n pseudo-random IPv4 prefixes with a length mix
+// loosely resembling a real policy set (mostly /24s and /32s, with a few
+// broader supernets), using a fixed seed so benchmark runs are comparable.
+func genPolicyCIDRs(n int) []netip.Prefix {
+	r := rand.New(rand.NewSource(1))
+	lens := []int{8, 16, 24, 24, 24, 32, 32, 32}
+	out := make([]netip.Prefix, n)
+	for i := range out {
+		bits := lens[r.Intn(len(lens))]
+		addr := netip.AddrFrom4([4]byte{byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256))})
+		out[i] = netip.PrefixFrom(addr, bits).Masked()
+	}
+	return out
+}
+
+// benchmarkCIDRLookup loads cidrs into a CIDRLookup[int] built by NewCIDRLookup,
+// then times looking each of them back up. Run with -tags cidrtable_bart to
+// compare CIDRTable against the default CIDRTrie.
+func benchmarkCIDRLookup(b *testing.B, cidrs []netip.Prefix) {
+	table := NewCIDRLookup[int]()
+	for i, c := range cidrs {
+		table.Upsert(c, i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		table.Lookup(cidrs[i%len(cidrs)])
+	}
+}
+
+func BenchmarkCIDRLookup_1K(b *testing.B)  { benchmarkCIDRLookup(b, genPolicyCIDRs(1_000)) }
+func BenchmarkCIDRLookup_10K(b *testing.B) { benchmarkCIDRLookup(b, genPolicyCIDRs(10_000)) }
+
+func BenchmarkCIDRLookup_Upsert(b *testing.B) {
+	cidrs := genPolicyCIDRs(b.N)
+	table := NewCIDRLookup[int]()
+	b.ResetTimer()
+	for i, c := range cidrs {
+		table.Upsert(c, i)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !cidrtable_bart
+
+package bitlpm
+
+// NewCIDRLookup creates the default CIDRLookup implementation: the
+// bit-at-a-time CIDRTrie. Build with -tags cidrtable_bart to switch to the
+// multi-bit-stride CIDRTable instead.
+func NewCIDRLookup[T any]() CIDRLookup[T] {
+	return NewCIDRTrie[T]()
+}
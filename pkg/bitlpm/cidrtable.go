@@ -0,0 +1,302 @@
+package bitlpm
+
+import (
+	"math/bits"
+	"net/netip"
+)
+
+// stride is the number of address bits consumed at each level of a
+// CIDRTable. An 8-bit stride means IPv4 lookups descend at most 4 levels
+// and IPv6 lookups descend at most 16, instead of walking one bit at a
+// time as CIDRTrie does.
+const stride = 8
+
+// octets is the number of distinct values a single stride can take
+// (2^stride).
+const octets = 1 << stride
+
+// prefixSlots is the number of positions in the complete binary tree that
+// backs a single node's stored prefixes: one slot per possible (value,
+// length) pair within the stride, for length 0..stride. Position 0 is
+// unused; a prefix of length l covering value v lives at 1<<l + (v>>(stride-l)).
+const prefixSlots = 2 * octets
+
+// bitset is a fixed-size bitset with O(1) rank support via PopCount. It is
+// used for both the "is a prefix stored here" set (size prefixSlots) and
+// the "is there a child here" set (size octets).
+type bitset []uint64
+
+func newBitset(bits int) bitset {
+	return make(bitset, (bits+63)/64)
+}
+
+func (b bitset) test(i uint) bool {
+	return b[i/64]&(1<<(i%64)) != 0
+}
+
+func (b bitset) set(i uint) {
+	b[i/64] |= 1 << (i % 64)
+}
+
+func (b bitset) clear(i uint) {
+	b[i/64] &^= 1 << (i % 64)
+}
+
+// rank returns the number of bits set in positions [0, i), i.e. the dense
+// array index that position i maps (or would map, if about to be set) to.
+func (b bitset) rank(i uint) int {
+	n := 0
+	word := i / 64
+	for w := uint(0); w < word; w++ {
+		n += bits.OnesCount64(b[w])
+	}
+	if rem := i % 64; rem > 0 {
+		n += bits.OnesCount64(b[word] & (1<<rem - 1))
+	}
+	return n
+}
+
+// bartNode is a single stride of a CIDRTable: a complete binary tree of
+// depth `stride` holding both the prefixes terminating in this stride and
+// the children that continue the walk into the next stride.
+type bartNode[T any] struct {
+	prefixes     bitset
+	prefixValues []T
+
+	children   bitset
+	childNodes []*bartNode[T]
+}
+
+func newBartNode[T any]() *bartNode[T] {
+	return &bartNode[T]{
+		prefixes: newBitset(prefixSlots),
+		children: newBitset(octets),
+	}
+}
+
+// baseIndex maps a stride value restricted to its top `bitsLen` bits to its
+// position in the complete binary tree used by the prefixes bitset.
+func baseIndex(value byte, bitsLen int) uint {
+	return uint(1)<<bitsLen + uint(value)>>(stride-bitsLen)
+}
+
+// pfxLenOf returns the number of stride-bits consumed by a baseIndex, the
+// inverse of the length component of baseIndex.
+func pfxLenOf(idx uint) int {
+	return bits.Len(idx) - 1
+}
+
+// split decomposes a total prefix length into the number of full strides
+// that are descended as child pointers (depth) and the number of bits
+// stored at the final stride (lastBits), 1 <= lastBits <= stride (0 only
+// when bitsLen itself is 0, i.e. a default route).
+func split(bitsLen int) (depth int, lastBits int) {
+	if bitsLen == 0 {
+		return 0, 0
+	}
+	depth = (bitsLen - 1) / stride
+	lastBits = bitsLen - depth*stride
+	return depth, lastBits
+}
+
+func (n *bartNode[T]) insertValue(idx uint, v T) (existed bool) {
+	pos := n.prefixes.rank(idx)
+	if n.prefixes.test(idx) {
+		n.prefixValues[pos] = v
+		return true
+	}
+	n.prefixes.set(idx)
+	n.prefixValues = append(n.prefixValues, v)
+	copy(n.prefixValues[pos+1:], n.prefixValues[pos:])
+	n.prefixValues[pos] = v
+	return false
+}
+
+func (n *bartNode[T]) deleteValue(idx uint) bool {
+	if !n.prefixes.test(idx) {
+		return false
+	}
+	pos := n.prefixes.rank(idx)
+	n.prefixes.clear(idx)
+	n.prefixValues = append(n.prefixValues[:pos], n.prefixValues[pos+1:]...)
+	return true
+}
+
+func (n *bartNode[T]) childAt(octet byte) (*bartNode[T], bool) {
+	if !n.children.test(uint(octet)) {
+		return nil, false
+	}
+	return n.childNodes[n.children.rank(uint(octet))], true
+}
+
+func (n *bartNode[T]) childOrCreate(octet byte) *bartNode[T] {
+	if c, ok := n.childAt(octet); ok {
+		return c
+	}
+	pos := n.children.rank(uint(octet))
+	n.children.set(uint(octet))
+	c := newBartNode[T]()
+	n.childNodes = append(n.childNodes, nil)
+	copy(n.childNodes[pos+1:], n.childNodes[pos:])
+	n.childNodes[pos] = c
+	return c
+}
+
+// lpm walks from the leaf position for octet up to the root of this node's
+// tree, returning the value of the most specific (longest) stored prefix
+// that covers octet, if any.
+func (n *bartNode[T]) lpm(octet byte, bitsAtNode int) (v T, idx uint, ok bool) {
+	for i := baseIndex(octet, bitsAtNode); i > 0; i >>= 1 {
+		if n.prefixes.test(i) {
+			return n.prefixValues[n.prefixes.rank(i)], i, true
+		}
+	}
+	return v, 0, false
+}
+
+// CIDRTable is a longest-prefix-match container with the same API as
+// CIDRTrie, backed by a "balanced routing table" (BART): each level
+// consumes a fixed 8-bit stride rather than a single bit, so an IPv6
+// lookup descends at most 16 nodes instead of up to 128. Within a stride,
+// prefixes and children are stored as bitsets over a complete binary tree
+// and compacted into dense arrays using PopCount-based rank, so a node
+// with few entries costs little more than a handful of words.
+type CIDRTable[T any] struct {
+	v4   *bartNode[T]
+	v6   *bartNode[T]
+	len4 uint
+	len6 uint
+}
+
+// NewCIDRTable creates a new CIDRTable[T].
+func NewCIDRTable[T any]() *CIDRTable[T] {
+	return &CIDRTable[T]{
+		v4: newBartNode[T](),
+		v6: newBartNode[T](),
+	}
+}
+
+func (c *CIDRTable[T]) treeForFamily(cidr netip.Prefix) (*bartNode[T], *uint) {
+	if cidr.Addr().Is6() {
+		return c.v6, &c.len6
+	}
+	return c.v4, &c.len4
+}
+
+// Lookup returns the longest matched value for a given prefix. Like
+// CIDRTrie.Lookup, it treats the prefix's address as fully specified
+// rather than bounding the walk to the prefix's own length.
+func (c *CIDRTable[T]) Lookup(cidr netip.Prefix) T {
+	root, _ := c.treeForFamily(cidr)
+	octs := cidr.Addr().AsSlice()
+	depth, last := split(cidr.Addr().BitLen())
+
+	var best T
+	node := root
+	for d := 0; ; d++ {
+		octet := octs[d]
+		bitsAtNode := stride
+		if d == depth {
+			bitsAtNode = last
+		}
+		if v, _, ok := node.lpm(octet, bitsAtNode); ok {
+			best = v
+		}
+		if d == depth {
+			break
+		}
+		next, ok := node.childAt(octet)
+		if !ok {
+			break
+		}
+		node = next
+	}
+	return best
+}
+
+// Path calls fn for every entry in the path from the root to the given
+// prefix, from least to most specific.
+func (c *CIDRTable[T]) Path(cidr netip.Prefix, fn func(k netip.Prefix, v T) bool) {
+	root, _ := c.treeForFamily(cidr)
+	octs := cidr.Addr().AsSlice()
+	depth, last := split(cidr.Bits())
+
+	node := root
+	for d := 0; ; d++ {
+		octet := octs[d]
+		bitsAtNode := stride
+		if d == depth {
+			bitsAtNode = last
+		}
+
+		var matches []uint
+		for idx := baseIndex(octet, bitsAtNode); idx > 0; idx >>= 1 {
+			if node.prefixes.test(idx) {
+				matches = append(matches, idx)
+			}
+		}
+		for i := len(matches) - 1; i >= 0; i-- {
+			idx := matches[i]
+			pfxLen := d*stride + pfxLenOf(idx)
+			pfx, err := cidr.Addr().Prefix(pfxLen)
+			if err != nil {
+				continue
+			}
+			if !fn(pfx, node.prefixValues[node.prefixes.rank(idx)]) {
+				return
+			}
+		}
+
+		if d == depth {
+			return
+		}
+		next, ok := node.childAt(octet)
+		if !ok {
+			return
+		}
+		node = next
+	}
+}
+
+// Upsert adds or updates the value for a given prefix.
+func (c *CIDRTable[T]) Upsert(cidr netip.Prefix, v T) {
+	root, length := c.treeForFamily(cidr)
+	octs := cidr.Addr().AsSlice()
+	depth, last := split(cidr.Bits())
+
+	node := root
+	for d := 0; d < depth; d++ {
+		node = node.childOrCreate(octs[d])
+	}
+	idx := baseIndex(octs[depth], last)
+	if !node.insertValue(idx, v) {
+		*length++
+	}
+}
+
+// Delete removes a given prefix from the table.
+func (c *CIDRTable[T]) Delete(cidr netip.Prefix) bool {
+	root, length := c.treeForFamily(cidr)
+	octs := cidr.Addr().AsSlice()
+	depth, last := split(cidr.Bits())
+
+	node := root
+	for d := 0; d < depth; d++ {
+		next, ok := node.childAt(octs[d])
+		if !ok {
+			return false
+		}
+		node = next
+	}
+	idx := baseIndex(octs[depth], last)
+	if node.deleteValue(idx) {
+		*length--
+		return true
+	}
+	return false
+}
+
+// Len returns the total number of IPv4 and IPv6 prefixes in the table.
+func (c *CIDRTable[T]) Len() uint {
+	return c.len4 + c.len6
+}
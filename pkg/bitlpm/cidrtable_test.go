@@ -0,0 +1,128 @@
+package bitlpm
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCIDRTable(t *testing.T) {
+
+	table := NewCIDRTable[string]()
+
+	prefixes := map[string]netip.Prefix{
+		"0":    netip.MustParsePrefix("0.0.0.0/0"),
+		"1":    netip.MustParsePrefix("1.0.0.0/8"),
+		"2a":   netip.MustParsePrefix("1.1.0.0/16"),
+		"2b":   netip.MustParsePrefix("1.2.0.0/16"),
+		"3a":   netip.MustParsePrefix("1.1.1.0/24"),
+		"3b":   netip.MustParsePrefix("1.2.1.0/24"),
+		"4a":   netip.MustParsePrefix("1.1.1.0/25"),
+		"4b":   netip.MustParsePrefix("1.1.1.128/25"),
+		"last": netip.MustParsePrefix("1.1.1.129/32"),
+	}
+
+	// These are prefixes that have a direct longer match
+	overridden := []string{
+		"3a", // because 1.1.1.0/24 -> 1.1.1.0/25
+	}
+
+	for name, prefix := range prefixes {
+		table.Upsert(prefix, name)
+	}
+
+	assert.EqualValues(t, len(prefixes), table.Len())
+
+loop:
+	for name := range prefixes {
+		for _, over := range overridden {
+			if name == over {
+				continue loop
+			}
+		}
+		have := table.Lookup(prefixes[name])
+		if have != name {
+			t.Errorf("Lookup(%s) returned %s want %s", prefixes[name].String(), have, name)
+		}
+	}
+
+	// Path should return the complete path to the prefix, same as CIDRTrie.
+	wantPath := []string{
+		"0",    // 0.0.0.0/0
+		"1",    // 1.0.0.0/8
+		"2a",   // 1.1.0.0/16
+		"3a",   // 1.1.1.0/24
+		"4b",   // 1.1.1.128/25
+		"last", // 1.1.1.129/32
+	}
+
+	havePath := []string{}
+	table.Path(prefixes["last"], func(k netip.Prefix, v string) bool {
+		wantK := prefixes[v]
+		if wantK != k {
+			t.Errorf("Path(%s) returned an unexpected key-value pair: k %s v %s", prefixes["last"], k.String(), v)
+		}
+		havePath = append(havePath, v)
+		return true
+	})
+	assert.Equal(t, wantPath, havePath)
+
+	for _, tc := range []struct {
+		k string
+		v string
+	}{
+		{
+			"1.1.1.130/32",
+			"4b",
+		},
+		{
+			"1.1.1.1/32",
+			"4a",
+		},
+		{
+			"1.24.0.0/32",
+			"1",
+		},
+		{
+			"24.24.24.24/32",
+			"0",
+		},
+	} {
+		assert.Equal(t, tc.v, table.Lookup(netip.MustParsePrefix(tc.k)))
+	}
+
+	assert.True(t, table.Delete(prefixes["last"]))
+	assert.False(t, table.Delete(prefixes["last"]))
+	assert.Equal(t, "4b", table.Lookup(prefixes["last"]))
+}
+
+func TestCIDRTableIPv6(t *testing.T) {
+	table := NewCIDRTable[string]()
+
+	table.Upsert(netip.MustParsePrefix("::/0"), "default")
+	table.Upsert(netip.MustParsePrefix("2001:db8::/32"), "doc")
+	table.Upsert(netip.MustParsePrefix("2001:db8:1::/48"), "doc-1")
+
+	assert.Equal(t, "doc-1", table.Lookup(netip.MustParsePrefix("2001:db8:1::1/128")))
+	assert.Equal(t, "doc", table.Lookup(netip.MustParsePrefix("2001:db8:2::1/128")))
+	assert.Equal(t, "default", table.Lookup(netip.MustParsePrefix("2002::1/128")))
+	assert.EqualValues(t, 3, table.Len())
+}
+
+func TestBaseIndex(t *testing.T) {
+	for _, tc := range []struct {
+		v    byte
+		l    int
+		want uint
+	}{
+		{0, 0, 1},
+		{0b1000_0000, 1, 3},
+		{0b0000_0000, 1, 2},
+		{0xff, 8, 511},
+		{0x00, 8, 256},
+	} {
+		assert.Equal(t, tc.want, baseIndex(tc.v, tc.l))
+		assert.Equal(t, tc.l, pfxLenOf(tc.want))
+	}
+}
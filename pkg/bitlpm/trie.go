@@ -0,0 +1,566 @@
+package bitlpm
+
+// Key describes the interface a concrete key type must implement to be
+// usable as the key of a Trie over a domain of values of type T, such as
+// netip.Prefix.
+type Key[T any] interface {
+	// BitValueAt returns the bit of the key at the given index, indexed
+	// from the most significant bit.
+	BitValueAt(idx uint) uint8
+	// CommonPrefix returns the number of leading bits this key shares
+	// with k2.
+	CommonPrefix(k2 T) uint
+	// Value returns the underlying domain value, e.g. the netip.Prefix a
+	// cidrKey was built from.
+	Value() T
+}
+
+// trieNode is a node of a binary patricia (radix) trie. Nodes are never
+// mutated after they are reachable from a Trie's root: every update
+// allocates new nodes along the modified path and reuses the rest of the
+// tree, so any older root a Clone captured stays valid.
+type trieNode[K Key[KV], KV any, V any] struct {
+	prefixLen uint
+	key       K
+	hasValue  bool
+	value     V
+	children  [2]*trieNode[K, KV, V]
+}
+
+// rootBox holds the mutable parts of a Trie (its root pointer and entry
+// count) behind a pointer that every copy of a Trie value shares. This is
+// what lets Trie's methods have value receivers (needed since callers
+// often hold a Trie by value, e.g. CIDRTrie.v4) while still mutating the
+// same logical trie in place for the non-immutable API.
+type rootBox[K Key[KV], KV any, V any] struct {
+	node  *trieNode[K, KV, V]
+	count uint
+}
+
+// Trie is a binary patricia trie keyed by K, a Key over the domain type
+// KV, storing values of type V. CIDRTrie builds its IPv4 and IPv6 trees
+// on top of this with K = Key[netip.Prefix] and KV = netip.Prefix.
+type Trie[K Key[KV], KV any, V any] struct {
+	maxPrefixBits uint
+	box           *rootBox[K, KV, V]
+}
+
+// NewTrie creates an empty Trie over keys with up to maxPrefixBits
+// significant bits.
+func NewTrie[KV any, V any](maxPrefixBits uint) Trie[Key[KV], KV, V] {
+	return Trie[Key[KV], KV, V]{
+		maxPrefixBits: maxPrefixBits,
+		box:           &rootBox[Key[KV], KV, V]{},
+	}
+}
+
+// Entry is a single (bits, key, value) tuple, as consumed by
+// NewTrieFromSlice.
+type Entry[K any, V any] struct {
+	Bits  uint
+	Key   K
+	Value V
+}
+
+// NewTrieFromSlice creates a Trie over keys with up to maxPrefixBits
+// significant bits and loads entries into it in one pass over the slice.
+// Since a Trie's depth is bounded by maxPrefixBits rather than its entry
+// count, this costs no more asymptotically than calling Upsert once per
+// entry on an empty Trie, but saves the caller from having to do so
+// itself.
+func NewTrieFromSlice[KV any, V any](maxPrefixBits uint, entries []Entry[Key[KV], V]) Trie[Key[KV], KV, V] {
+	t := NewTrie[KV, V](maxPrefixBits)
+	for _, e := range entries {
+		t.Upsert(e.Bits, e.Key, e.Value)
+	}
+	return t
+}
+
+// Len returns the number of entries stored in the trie.
+func (t Trie[K, KV, V]) Len() uint {
+	return t.box.count
+}
+
+// Lookup returns the value of the longest stored prefix that covers key,
+// treating key as a fully specified address rather than bounding the walk
+// to key's own prefix length. The zero value of V is returned if nothing
+// covers key.
+func (t Trie[K, KV, V]) Lookup(key K) V {
+	var best V
+	n := t.box.node
+	for n != nil {
+		if key.CommonPrefix(n.key.Value()) < n.prefixLen {
+			break
+		}
+		if n.hasValue {
+			best = n.value
+		}
+		if n.prefixLen >= t.maxPrefixBits {
+			break
+		}
+		n = n.children[key.BitValueAt(n.prefixLen)]
+	}
+	return best
+}
+
+// Search calls fn for every stored prefix along the path from the root to
+// the given (bits, key), from least to most specific, stopping early if
+// fn returns false.
+func (t Trie[K, KV, V]) Search(bits uint, key K, fn func(prefix uint, k K, v V) bool) {
+	n := t.box.node
+	for n != nil && n.prefixLen <= bits {
+		if key.CommonPrefix(n.key.Value()) < n.prefixLen {
+			return
+		}
+		if n.hasValue {
+			if !fn(n.prefixLen, n.key, n.value) {
+				return
+			}
+		}
+		if n.prefixLen >= t.maxPrefixBits || n.prefixLen >= bits {
+			return
+		}
+		n = n.children[key.BitValueAt(n.prefixLen)]
+	}
+}
+
+// Upsert adds or updates the value stored for (bits, key).
+func (t Trie[K, KV, V]) Upsert(bits uint, key K, value V) {
+	newRoot, grew := upsertNode[K, KV, V](t.box.node, bits, key, value, t.maxPrefixBits)
+	t.box.node = newRoot
+	if grew {
+		t.box.count++
+	}
+}
+
+// Delete removes the entry stored for (bits, key), reporting whether it
+// was present.
+func (t Trie[K, KV, V]) Delete(bits uint, key K) bool {
+	newRoot, deleted := deleteNode[K, KV, V](t.box.node, bits, key, t.maxPrefixBits)
+	if !deleted {
+		return false
+	}
+	t.box.node = newRoot
+	t.box.count--
+	return true
+}
+
+// Clone returns an O(1) snapshot of the trie that shares all of the
+// receiver's nodes. Since Upsert/Delete/UpsertImmutable/DeleteImmutable
+// never mutate an existing node in place (they always path-copy), the
+// snapshot stays valid no matter what happens to the receiver afterwards.
+func (t Trie[K, KV, V]) Clone() Trie[K, KV, V] {
+	return Trie[K, KV, V]{
+		maxPrefixBits: t.maxPrefixBits,
+		box:           &rootBox[K, KV, V]{node: t.box.node, count: t.box.count},
+	}
+}
+
+// UpsertImmutable adds or updates the value stored for (bits, key) and
+// returns a new Trie reflecting the change. The receiver is left
+// untouched: only the nodes on the path to (bits, key) are copied, the
+// rest of the tree is shared between the receiver and the result.
+func (t Trie[K, KV, V]) UpsertImmutable(bits uint, key K, value V) Trie[K, KV, V] {
+	newRoot, grew := upsertNode[K, KV, V](t.box.node, bits, key, value, t.maxPrefixBits)
+	count := t.box.count
+	if grew {
+		count++
+	}
+	return Trie[K, KV, V]{
+		maxPrefixBits: t.maxPrefixBits,
+		box:           &rootBox[K, KV, V]{node: newRoot, count: count},
+	}
+}
+
+// DeleteImmutable removes the entry stored for (bits, key) and returns a
+// new Trie reflecting the change, leaving the receiver untouched. ok
+// reports whether the entry was present to remove.
+func (t Trie[K, KV, V]) DeleteImmutable(bits uint, key K) (out Trie[K, KV, V], ok bool) {
+	newRoot, deleted := deleteNode[K, KV, V](t.box.node, bits, key, t.maxPrefixBits)
+	if !deleted {
+		return t.Clone(), false
+	}
+	return Trie[K, KV, V]{
+		maxPrefixBits: t.maxPrefixBits,
+		box:           &rootBox[K, KV, V]{node: newRoot, count: t.box.count - 1},
+	}, true
+}
+
+// Subtree calls fn, in ascending key order, for every stored entry that is
+// a strict subnet of (bits, key): every entry reached by descending past a
+// node exactly matching (bits, key), or, if no such node exists, every
+// entry in the subtree rooted at the first node more specific than
+// (bits, key) found along the path to it, that node included.
+func (t Trie[K, KV, V]) Subtree(bits uint, key K, fn func(bits uint, k K, v V) bool) {
+	n := t.box.node
+	for n != nil {
+		limit := n.prefixLen
+		if bits < limit {
+			// n is already more specific than (bits, key): only agreement up
+			// to bits is required for n to fall inside the queried subtree,
+			// not all the way out to n.prefixLen.
+			limit = bits
+		}
+		if key.CommonPrefix(n.key.Value()) < limit {
+			return
+		}
+		if n.prefixLen > bits {
+			// n, and everything below it, is strictly more specific than
+			// (bits, key): visit the whole subtree rooted at n.
+			allNode(n, fn)
+			return
+		}
+		if n.prefixLen == bits {
+			// n is (bits, key) itself: visit its strict descendants only.
+			if allNode(n.children[0], fn) {
+				allNode(n.children[1], fn)
+			}
+			return
+		}
+		if n.prefixLen >= t.maxPrefixBits {
+			return
+		}
+		n = n.children[key.BitValueAt(n.prefixLen)]
+	}
+}
+
+// Union merges other into the receiver, combining values present in both
+// using merge. The two tries are walked together so merging is O(n+m),
+// rather than the O(m log n) of re-inserting every entry of other with
+// Upsert.
+func (t Trie[K, KV, V]) Union(other Trie[K, KV, V], merge func(a, b V) V) {
+	newRoot, added := mergeNode[K, KV, V](t.box.node, other.box.node, t.maxPrefixBits, merge)
+	t.box.node = newRoot
+	t.box.count += added
+}
+
+// All calls fn for every stored (bits, key, value) in ascending key order,
+// stopping early if fn returns false.
+func (t Trie[K, KV, V]) All(fn func(bits uint, k K, v V) bool) {
+	allNode[K, KV, V](t.box.node, fn)
+}
+
+// Range calls fn for every stored (bits, key, value) whose key falls within
+// [start, end] (inclusive), in ascending key order. Any subtree whose
+// entire key range falls outside [start, end] is pruned rather than
+// visited.
+func (t Trie[K, KV, V]) Range(start, end K, fn func(bits uint, k K, v V) bool) {
+	rangeNode[K, KV, V](t.box.node, start, end, t.maxPrefixBits, fn)
+}
+
+// First returns the stored entry with the smallest key. ok is false if the
+// trie is empty.
+func (t Trie[K, KV, V]) First() (k K, v V, ok bool) {
+	if n, found := firstNode[K, KV, V](t.box.node); found {
+		return n.key, n.value, true
+	}
+	return k, v, false
+}
+
+// Last returns the stored entry with the largest key. ok is false if the
+// trie is empty.
+func (t Trie[K, KV, V]) Last() (k K, v V, ok bool) {
+	if n, found := lastNode[K, KV, V](t.box.node); found {
+		return n.key, n.value, true
+	}
+	return k, v, false
+}
+
+// allNode calls fn for every value-bearing node of the subtree rooted at n,
+// in ascending key order (the node itself, then its children in bit
+// order, same traversal Search/Path use for a single root-to-leaf path).
+// It returns false if fn returned false and the walk was stopped early.
+func allNode[K Key[KV], KV any, V any](n *trieNode[K, KV, V], fn func(bits uint, k K, v V) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.hasValue && !fn(n.prefixLen, n.key, n.value) {
+		return false
+	}
+	if !allNode(n.children[0], fn) {
+		return false
+	}
+	return allNode(n.children[1], fn)
+}
+
+// sizeNode returns the number of value-bearing nodes in the subtree rooted
+// at n.
+func sizeNode[K Key[KV], KV any, V any](n *trieNode[K, KV, V]) uint {
+	if n == nil {
+		return 0
+	}
+	count := sizeNode(n.children[0]) + sizeNode(n.children[1])
+	if n.hasValue {
+		count++
+	}
+	return count
+}
+
+// mergeNode returns the root of the subtree resulting from merging a and
+// b, combining values present in both using merge, without mutating a, b
+// or any of their descendants: every node where the two subtrees
+// genuinely overlap is copied, the rest of each subtree is reused as-is.
+// added is the number of entries present in b but not in a, i.e. the
+// resulting subtree holds sizeNode(a)+added entries.
+func mergeNode[K Key[KV], KV any, V any](a, b *trieNode[K, KV, V], maxBits uint, merge func(x, y V) V) (*trieNode[K, KV, V], uint) {
+	if b == nil {
+		return a, 0
+	}
+	if a == nil {
+		return b, sizeNode(b)
+	}
+
+	common := commonPrefixLen[K, KV](a.key, b.key, a.prefixLen, b.prefixLen, maxBits)
+	switch {
+	case a.prefixLen == b.prefixLen && common == a.prefixLen:
+		// Same node position: combine values, merge children pairwise. A
+		// valueless node's key is just a representative leaf used for bit
+		// tests, not necessarily masked to prefixLen, so it must travel with
+		// whichever side's value is actually being stored here.
+		cp := &trieNode[K, KV, V]{prefixLen: a.prefixLen, key: a.key, hasValue: a.hasValue, value: a.value}
+		var added uint
+		if b.hasValue {
+			if a.hasValue {
+				cp.value = merge(a.value, b.value)
+			} else {
+				cp.key = b.key
+				cp.hasValue = true
+				cp.value = b.value
+				added++
+			}
+		}
+		for i := range cp.children {
+			child, n := mergeNode(a.children[i], b.children[i], maxBits, merge)
+			cp.children[i] = child
+			added += n
+		}
+		return cp, added
+
+	case a.prefixLen < b.prefixLen && common == a.prefixLen:
+		// a is a strict ancestor of b: descend into a's child on b's side.
+		bit := b.key.BitValueAt(a.prefixLen)
+		cp := *a
+		child, added := mergeNode(a.children[bit], b, maxBits, merge)
+		cp.children[bit] = child
+		return &cp, added
+
+	case b.prefixLen < a.prefixLen && common == b.prefixLen:
+		// b is a strict ancestor of a: b becomes the new parent, a descends
+		// into b's child on a's side, b's other child is carried as-is.
+		bit := a.key.BitValueAt(b.prefixLen)
+		other := 1 - bit
+		cp := &trieNode[K, KV, V]{prefixLen: b.prefixLen, key: b.key, hasValue: b.hasValue, value: b.value}
+		cp.children[other] = b.children[other]
+		added := sizeNode(b.children[other])
+		if b.hasValue {
+			added++
+		}
+		child, n := mergeNode(a, b.children[bit], maxBits, merge)
+		cp.children[bit] = child
+		added += n
+		return cp, added
+
+	default:
+		// a and b diverge at `common`: branch.
+		branch := &trieNode[K, KV, V]{prefixLen: common, key: a.key}
+		branch.children[a.key.BitValueAt(common)] = a
+		branch.children[b.key.BitValueAt(common)] = b
+		return branch, sizeNode(b)
+	}
+}
+
+// comparePrefixBits compares a and b's leading `bits` bits (MSB first),
+// returning -1, 0 or 1. It is used to decide whether a node's whole
+// subtree can fall entirely below or above a Range bound without
+// inspecting every entry in it.
+func comparePrefixBits[K Key[KV], KV any](a, b K, bits uint) int {
+	common := a.CommonPrefix(b.Value())
+	if common >= bits {
+		return 0
+	}
+	if a.BitValueAt(common) < b.BitValueAt(common) {
+		return -1
+	}
+	return 1
+}
+
+// rangeNode calls fn for every value-bearing node of the subtree rooted at
+// n whose key falls within [start, end], pruning subtrees that fall
+// entirely outside the range. It returns false if fn returned false and
+// the walk was stopped early.
+func rangeNode[K Key[KV], KV any, V any](n *trieNode[K, KV, V], start, end K, maxBits uint, fn func(bits uint, k K, v V) bool) bool {
+	if n == nil {
+		return true
+	}
+	if comparePrefixBits[K, KV](n.key, start, n.prefixLen) < 0 || comparePrefixBits[K, KV](n.key, end, n.prefixLen) > 0 {
+		return true
+	}
+	if n.hasValue && comparePrefixBits[K, KV](n.key, start, maxBits) >= 0 && comparePrefixBits[K, KV](n.key, end, maxBits) <= 0 {
+		if !fn(n.prefixLen, n.key, n.value) {
+			return false
+		}
+	}
+	if !rangeNode(n.children[0], start, end, maxBits, fn) {
+		return false
+	}
+	return rangeNode(n.children[1], start, end, maxBits, fn)
+}
+
+// firstNode returns the value-bearing node with the smallest key in the
+// subtree rooted at n, by visiting n itself before its children in bit
+// order (the same order allNode uses).
+func firstNode[K Key[KV], KV any, V any](n *trieNode[K, KV, V]) (*trieNode[K, KV, V], bool) {
+	if n == nil {
+		return nil, false
+	}
+	if n.hasValue {
+		return n, true
+	}
+	if f, ok := firstNode(n.children[0]); ok {
+		return f, true
+	}
+	return firstNode(n.children[1])
+}
+
+// lastNode returns the value-bearing node with the largest key in the
+// subtree rooted at n, by visiting n's children in reverse bit order
+// before n itself.
+func lastNode[K Key[KV], KV any, V any](n *trieNode[K, KV, V]) (*trieNode[K, KV, V], bool) {
+	if n == nil {
+		return nil, false
+	}
+	if l, ok := lastNode(n.children[1]); ok {
+		return l, true
+	}
+	if l, ok := lastNode(n.children[0]); ok {
+		return l, true
+	}
+	if n.hasValue {
+		return n, true
+	}
+	return nil, false
+}
+
+// commonPrefixLen returns the number of leading bits a and b share,
+// bounded by both of their declared prefix lengths and by maxBits.
+func commonPrefixLen[K Key[KV], KV any](a, b K, aBits, bBits, maxBits uint) uint {
+	common := a.CommonPrefix(b.Value())
+	limit := aBits
+	if bBits < limit {
+		limit = bBits
+	}
+	if maxBits < limit {
+		limit = maxBits
+	}
+	if common > limit {
+		common = limit
+	}
+	return common
+}
+
+// upsertNode returns the root of the subtree resulting from inserting
+// (bits, key, value) under n, without mutating n or any of its
+// descendants: every node on the path to the insertion point is copied,
+// the rest of the subtree is reused as-is.
+func upsertNode[K Key[KV], KV any, V any](n *trieNode[K, KV, V], bits uint, key K, value V, maxBits uint) (*trieNode[K, KV, V], bool) {
+	if n == nil {
+		return &trieNode[K, KV, V]{prefixLen: bits, key: key, hasValue: true, value: value}, true
+	}
+
+	// commonPrefixLen clamps common to at most min(n.prefixLen, bits), so
+	// common reaching n.prefixLen (resp. bits) means n's (resp. the new
+	// entry's) whole prefix matched, not just that many bits happened to
+	// agree. The previous conditions here ("common >= n.prefixLen &&
+	// common >= bits") were only ever satisfiable when n.prefixLen == bits,
+	// making the shorter/longer descend cases below it unreachable dead
+	// code: any insert where one side was a strict ancestor of the other
+	// fell through to the branch case instead and silently dropped the
+	// existing entry.
+	common := commonPrefixLen[K, KV](n.key, key, n.prefixLen, bits, maxBits)
+	switch {
+	case n.prefixLen == bits && common == bits:
+		// Exact match: replace the value, share the existing children.
+		return &trieNode[K, KV, V]{
+			prefixLen: n.prefixLen,
+			key:       key,
+			hasValue:  true,
+			value:     value,
+			children:  n.children,
+		}, !n.hasValue
+
+	case n.prefixLen < bits && common == n.prefixLen:
+		// n is shorter than the new entry: descend into n's child on the
+		// new key's side, copying n and sharing its other child.
+		bit := key.BitValueAt(n.prefixLen)
+		child, grew := upsertNode[K, KV, V](n.children[bit], bits, key, value, maxBits)
+		cp := *n
+		cp.children[bit] = child
+		return &cp, grew
+
+	case bits < n.prefixLen && common == bits:
+		// The new entry is a strict supernet of n: it becomes the parent.
+		bit := n.key.BitValueAt(bits)
+		parent := &trieNode[K, KV, V]{prefixLen: bits, key: key, hasValue: true, value: value}
+		parent.children[bit] = n
+		return parent, true
+
+	default:
+		// n and the new entry diverge at `common`: branch.
+		branch := &trieNode[K, KV, V]{prefixLen: common, key: n.key}
+		bitExisting := n.key.BitValueAt(common)
+		bitNew := key.BitValueAt(common)
+		branch.children[bitExisting] = n
+		branch.children[bitNew] = &trieNode[K, KV, V]{prefixLen: bits, key: key, hasValue: true, value: value}
+		return branch, true
+	}
+}
+
+// deleteNode returns the root of the subtree resulting from removing
+// (bits, key) from under n, path-copying along the way and collapsing any
+// intermediate node left with at most one child.
+func deleteNode[K Key[KV], KV any, V any](n *trieNode[K, KV, V], bits uint, key K, maxBits uint) (*trieNode[K, KV, V], bool) {
+	if n == nil {
+		return nil, false
+	}
+	if key.CommonPrefix(n.key.Value()) < n.prefixLen {
+		return n, false
+	}
+	if n.prefixLen == bits {
+		if !n.hasValue {
+			return n, false
+		}
+		cp := &trieNode[K, KV, V]{prefixLen: n.prefixLen, key: n.key, children: n.children}
+		return compactNode(cp), true
+	}
+	if n.prefixLen > bits || n.prefixLen >= maxBits {
+		return n, false
+	}
+	bit := key.BitValueAt(n.prefixLen)
+	child, deleted := deleteNode[K, KV, V](n.children[bit], bits, key, maxBits)
+	if !deleted {
+		return n, false
+	}
+	cp := *n
+	cp.children[bit] = child
+	return compactNode(&cp), true
+}
+
+// compactNode removes a valueless node that has at most one remaining
+// child, splicing it out of the tree.
+func compactNode[K Key[KV], KV any, V any](n *trieNode[K, KV, V]) *trieNode[K, KV, V] {
+	if n.hasValue {
+		return n
+	}
+	var only *trieNode[K, KV, V]
+	children := 0
+	for _, c := range n.children {
+		if c != nil {
+			children++
+			only = c
+		}
+	}
+	if children <= 1 {
+		return only
+	}
+	return n
+}
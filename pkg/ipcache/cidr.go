@@ -30,6 +30,12 @@ var (
 	IdentityAllocator cache.IdentityAllocator
 )
 
+// cidrAllocateBatchSize bounds how many prefixes are allocated while
+// holding IPIdentityCache.Lock() at a time. AllocateCIDRs releases and
+// re-acquires the lock between batches so a bulk allocation of thousands
+// of prefixes does not stall ipcache readers for its entire duration.
+const cidrAllocateBatchSize = 1024
+
 // AllocateCIDRs attempts to allocate identities for a list of CIDRs. If any
 // allocation fails, all allocations are rolled back and the error is returned.
 // When an identity is freshly allocated for a CIDR, it is added to the
@@ -43,8 +49,12 @@ var (
 //
 // Upon success, the caller must also arrange for the resulting identities to
 // be released via a subsequent call to ReleaseCIDRIdentitiesByCIDR().
+//
+// ctx governs the whole allocation: if it is cancelled partway through a
+// large batch of prefixes, AllocateCIDRs stops allocating further prefixes,
+// rolls back what it already allocated, and returns ctx.Err().
 func AllocateCIDRs(
-	prefixes []*net.IPNet, oldNIDs []identity.NumericIdentity, newlyAllocatedIdentities map[string]*identity.Identity,
+	ctx context.Context, prefixes []*net.IPNet, oldNIDs []identity.NumericIdentity, newlyAllocatedIdentities map[string]*identity.Identity,
 ) ([]*identity.Identity, error) {
 	// maintain list of used identities to undo on error
 	usedIdentities := make([]*identity.Identity, 0, len(prefixes))
@@ -57,34 +67,60 @@ func AllocateCIDRs(
 		newlyAllocatedIdentities = map[string]*identity.Identity{}
 	}
 
-	IPIdentityCache.Lock()
-	allocatedIdentities := make(map[string]*identity.Identity, len(prefixes))
-	for i, p := range prefixes {
-		if p == nil {
-			continue
+	rollback := func(err error) error {
+		// If ctx is already done, release with a fresh context so that the
+		// rollback itself is not aborted by the same cancellation.
+		releaseCtx := ctx
+		if ctx.Err() != nil {
+			releaseCtx = context.Background()
 		}
+		IdentityAllocator.ReleaseSlice(releaseCtx, nil, usedIdentities)
+		return err
+	}
 
-		lbls := cidr.GetCIDRLabels(p)
-		lbls.MergeLabels(GetIDMetadataByIP(p.IP.String()))
-		oldNID := identity.InvalidIdentity
-		if oldNIDs != nil && len(oldNIDs) > i {
-			oldNID = oldNIDs[i]
+	allocatedIdentities := make(map[string]*identity.Identity, len(prefixes))
+	for batchStart := 0; batchStart < len(prefixes); batchStart += cidrAllocateBatchSize {
+		if err := ctx.Err(); err != nil {
+			return nil, rollback(err)
 		}
-		id, isNew, err := allocate(p, lbls, oldNID)
-		if err != nil {
-			IPIdentityCache.Unlock()
-			IdentityAllocator.ReleaseSlice(context.Background(), nil, usedIdentities)
-			return nil, err
+
+		batchEnd := batchStart + cidrAllocateBatchSize
+		if batchEnd > len(prefixes) {
+			batchEnd = len(prefixes)
 		}
 
-		prefixStr := p.String()
-		usedIdentities = append(usedIdentities, id)
-		allocatedIdentities[prefixStr] = id
-		if isNew {
-			newlyAllocatedIdentities[prefixStr] = id
+		IPIdentityCache.Lock()
+		for i := batchStart; i < batchEnd; i++ {
+			if err := ctx.Err(); err != nil {
+				IPIdentityCache.Unlock()
+				return nil, rollback(err)
+			}
+			p := prefixes[i]
+			if p == nil {
+				continue
+			}
+
+			lbls := cidr.GetCIDRLabels(p)
+			lbls.MergeLabels(GetIDMetadataByIP(p.IP.String()))
+			oldNID := identity.InvalidIdentity
+			if oldNIDs != nil && len(oldNIDs) > i {
+				oldNID = oldNIDs[i]
+			}
+			id, isNew, err := allocate(ctx, p, lbls, oldNID)
+			if err != nil {
+				IPIdentityCache.Unlock()
+				return nil, rollback(err)
+			}
+
+			prefixStr := p.String()
+			usedIdentities = append(usedIdentities, id)
+			allocatedIdentities[prefixStr] = id
+			if isNew {
+				newlyAllocatedIdentities[prefixStr] = id
+			}
 		}
+		IPIdentityCache.Unlock()
 	}
-	IPIdentityCache.Unlock()
 
 	// Only upsert into ipcache if identity wasn't allocated
 	// before and the caller does not care doing this
@@ -105,9 +141,9 @@ func AllocateCIDRs(
 // Upon success, the caller must also arrange for the resulting identities to
 // be released via a subsequent call to ReleaseCIDRIdentitiesByID().
 func AllocateCIDRsForIPs(
-	prefixes []net.IP, newlyAllocatedIdentities map[string]*identity.Identity,
+	ctx context.Context, prefixes []net.IP, newlyAllocatedIdentities map[string]*identity.Identity,
 ) ([]*identity.Identity, error) {
-	return AllocateCIDRs(ip.GetCIDRPrefixesFromIPs(prefixes), nil, newlyAllocatedIdentities)
+	return AllocateCIDRs(ctx, ip.GetCIDRPrefixesFromIPs(prefixes), nil, newlyAllocatedIdentities)
 }
 
 func cidrLabelToPrefix(label string) (string, bool) {
@@ -174,16 +210,13 @@ func UpsertGeneratedIdentities(newlyAllocatedIdentities map[string]*identity.Ide
 // previous numeric identity exists.
 //
 // It is up to the caller to provide the full set of labels for identity
-// allocation.
-func allocate(prefix *net.IPNet, lbls labels.Labels, oldNID identity.NumericIdentity) (*identity.Identity, bool, error) {
+// allocation, and ctx to bound how long the allocation may take.
+func allocate(ctx context.Context, prefix *net.IPNet, lbls labels.Labels, oldNID identity.NumericIdentity) (*identity.Identity, bool, error) {
 	if prefix == nil {
 		return nil, false, nil
 	}
 
-	allocateCtx, cancel := context.WithTimeout(context.Background(), option.Config.IPAllocationTimeout)
-	defer cancel()
-
-	id, isNew, err := IdentityAllocator.AllocateIdentity(allocateCtx, lbls, false, oldNID)
+	id, isNew, err := IdentityAllocator.AllocateIdentity(ctx, lbls, false, oldNID)
 	if err != nil {
 		return nil, isNew, fmt.Errorf("failed to allocate identity for cidr %s: %s", prefix, err)
 	}
@@ -228,9 +261,11 @@ func releaseCIDRIdentities(ctx context.Context, identities map[string]*identity.
 
 // ReleaseCIDRIdentitiesByCIDR releases the identities of a list of CIDRs.
 // When the last use of the identity is released, the ipcache entry is deleted.
-func ReleaseCIDRIdentitiesByCIDR(prefixes []*net.IPNet) {
-	// TODO: Structure the code to pass context down from the Daemon.
-	releaseCtx, cancel := context.WithTimeout(context.TODO(), option.Config.KVstoreConnectivityTimeout)
+func ReleaseCIDRIdentitiesByCIDR(ctx context.Context, prefixes []*net.IPNet) {
+	// Bound KVstore lookups even if the caller passed us an undeadlined
+	// context (e.g. context.Background() on a release/cleanup path), so a
+	// stuck KVstore can't hang this call forever.
+	releaseCtx, cancel := context.WithTimeout(ctx, option.Config.KVstoreConnectivityTimeout)
 	defer cancel()
 
 	identities := make(map[string]*identity.Identity, len(prefixes))